@@ -0,0 +1,165 @@
+//go:build linux
+// +build linux
+
+package capture
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+const (
+	afpacketDefaultBlockSize = 1 << 20 // 1MiB
+	afpacketDefaultNumBlocks = 64
+)
+
+// afpacketFanoutGroupSeq hands out a unique PACKET_FANOUT group id to each
+// Listener that activates the af_packet engine, so two Listeners started
+// concurrently (e.g. two --input-raw instances on the same host) can never
+// land in the same group and silently split each other's traffic instead of
+// each seeing the full stream. Read with atomic.AddUint32 only; the id it
+// produces is then stored on the Listener (fanoutGroup) and reused by every
+// socket that Listener opens on one interface. Each interface gets its own
+// id, since the kernel only lets sockets bound to the same device share a
+// fanout group.
+var afpacketFanoutGroupSeq uint32
+
+// nextAFPacketFanoutGroup allocates the next PACKET_FANOUT group id.
+func nextAFPacketFanoutGroup() uint16 {
+	return uint16(atomic.AddUint32(&afpacketFanoutGroupSeq, 1))
+}
+
+// afpacketHandle adapts a TPACKET_V3 *afpacket.TPacket ring to captureHandle.
+// af_packet always delivers raw Ethernet frames, so LinkType is fixed, and
+// its Stats() reports the TPACKET_V3 socket's dropped packets rather than libpcap's
+// kernel/interface split.
+type afpacketHandle struct {
+	*afpacket.TPacket
+}
+
+func (h afpacketHandle) LinkType() layers.LinkType {
+	return layers.LinkTypeEthernet
+}
+
+func (h afpacketHandle) Stats() (HandleStats, error) {
+	_, statsV3, err := h.TPacket.SocketStats()
+	if err != nil {
+		return HandleStats{}, err
+	}
+	return HandleStats{
+		PacketsReceived: uint64(statsV3.Packets()),
+		PacketsDropped:  uint64(statsV3.Drops()),
+	}, nil
+}
+
+// fanoutMode resolves the configured AFPacketFanoutMode to its afpacket
+// constant, defaulting to hash-based distribution.
+func (l *Listener) fanoutMode() afpacket.FanoutType {
+	switch l.AFPacketFanoutMode {
+	case "lb":
+		return afpacket.FanoutLoadBalance
+	case "cpu":
+		return afpacket.FanoutCPU
+	case "rollover":
+		return afpacket.FanoutRollover
+	case "random":
+		return afpacket.FanoutRandom
+	case "qm":
+		return afpacket.FanoutQueueMapping
+	case "", "hash":
+		return afpacket.FanoutHash
+	default:
+		return afpacket.FanoutHash
+	}
+}
+
+// newAFPacketHandle opens one TPACKET_V3 ring bound to ifi and joins it to
+// the PACKET_FANOUT group currently allocated for ifi, so that on multi-core hosts several
+// sockets per interface can be read from concurrently.
+func (l *Listener) newAFPacketHandle(ifi NetInterface) (captureHandle, error) {
+	blockSize := int(l.AFPacketBlockSize)
+	if blockSize == 0 {
+		blockSize = afpacketDefaultBlockSize
+	}
+	numBlocks := l.AFPacketNumBlocks
+	if numBlocks == 0 {
+		numBlocks = afpacketDefaultNumBlocks
+	}
+	pollTimeout := l.AFPacketPollTimeout
+	if pollTimeout == 0 {
+		pollTimeout = pcap.BlockForever
+	}
+
+	tp, err := afpacket.NewTPacket(
+		afpacket.OptInterface(ifi.Name),
+		afpacket.OptFrameSize(afpacket.DefaultFrameSize),
+		afpacket.OptBlockSize(blockSize),
+		afpacket.OptNumBlocks(numBlocks),
+		afpacket.OptPollTimeout(pollTimeout),
+		afpacket.OptTPacketVersion(afpacket.TPacketVersion3),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("af_packet handle error: %q, interface: %q, block size: %d, num blocks: %d", err, ifi.Name, blockSize, numBlocks)
+	}
+
+	if l.BPFFilter == "" {
+		l.BPFFilter = l.Filter(ifi)
+	}
+	insns, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, 65535, l.BPFFilter)
+	if err != nil {
+		tp.Close()
+		return nil, fmt.Errorf("BPF filter error: %q%s, interface: %q", err, l.BPFFilter, ifi.Name)
+	}
+	raw := make([]bpf.RawInstruction, len(insns))
+	for i, insn := range insns {
+		raw[i] = bpf.RawInstruction{Op: insn.Code, Jt: insn.Jt, Jf: insn.Jf, K: insn.K}
+	}
+	if err = tp.SetBPF(raw); err != nil {
+		tp.Close()
+		return nil, fmt.Errorf("af_packet BPF filter error: %q, interface: %q", err, ifi.Name)
+	}
+
+	if err = tp.SetFanout(l.fanoutMode(), l.fanoutGroup); err != nil {
+		tp.Close()
+		return nil, fmt.Errorf("af_packet fanout error: %q, interface: %q", err, ifi.Name)
+	}
+
+	return afpacketHandle{tp}, nil
+}
+
+// activateAFPacket opens TPACKET_V3 rings for every interface, spawning one
+// socket per CPU per interface so PACKET_FANOUT can spread packets across
+// reader goroutines. l.read() starts one goroutine per socket, same as the
+// libpcap engine.
+func (l *Listener) activateAFPacket() error {
+	var msg string
+	sockets := runtime.NumCPU()
+	if sockets < 1 {
+		sockets = 1
+	}
+	for _, ifi := range l.Interfaces {
+		l.fanoutGroup = nextAFPacketFanoutGroup()
+		for i := 0; i < sockets; i++ {
+			handle, err := l.newAFPacketHandle(ifi)
+			if err != nil {
+				msg += "\n" + err.Error()
+				continue
+			}
+			key := ifi.Name
+			if i > 0 {
+				key = fmt.Sprintf("%s#%d", ifi.Name, i)
+			}
+			l.Handles[key] = handle
+		}
+	}
+	if len(l.Handles) == 0 {
+		return fmt.Errorf("af_packet handles error:%s", msg)
+	}
+	return nil
+}
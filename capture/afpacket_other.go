@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package capture
+
+import "fmt"
+
+// activateAFPacket is only available on Linux, where PACKET_FANOUT and
+// TPACKET_V3 rings exist. On other platforms EngineAFPacket fails fast.
+func (l *Listener) activateAFPacket() error {
+	return fmt.Errorf("af_packet engine is only supported on linux")
+}
@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/buger/goreplay/size"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
 )
 
 // TransportLayers current supported transport layers
@@ -33,6 +36,29 @@ type PcapOptions struct {
 	TimestampType string        `json:"input-raw-timestamp-type"`
 	BufferSize    size.Size     `json:"input-raw-buffer-size"`
 	BPFFilter     string        `json:"input-raw-bpf-filter"`
+
+	// AFPacketBlockSize is the size in bytes of a single TPACKET_V3 ring block.
+	// Only used by EngineAFPacket.
+	AFPacketBlockSize size.Size `json:"input-raw-af-packet-block-size"`
+	// AFPacketNumBlocks is the number of TPACKET_V3 ring blocks to allocate.
+	// Only used by EngineAFPacket.
+	AFPacketNumBlocks int `json:"input-raw-af-packet-num-blocks"`
+	// AFPacketPollTimeout bounds how long a ring read blocks waiting for
+	// a frame before it returns a timeout error, which the packet source
+	// retries rather than treating as end of input.
+	// Only used by EngineAFPacket.
+	AFPacketPollTimeout time.Duration `json:"input-raw-af-packet-poll-timeout"`
+	// AFPacketFanoutMode selects the PACKET_FANOUT load-balancing mode
+	// ("hash", "lb", "cpu", "rollover", "random", "qm") used when more
+	// than one socket is opened per interface. Defaults to "hash".
+	AFPacketFanoutMode string `json:"input-raw-af-packet-fanout-mode"`
+
+	// Writable is a precondition Inject/InjectLayers check before sending:
+	// it does not change how handles are opened (the OS handle supports
+	// writing either way), it only gates whether this Listener is allowed
+	// to use it for injection. Leave false for capture-only listeners so
+	// a stray Inject call fails loudly instead of writing to the wire.
+	Writable bool `json:"input-raw-writable"`
 }
 
 // NetInterface represents network interface
@@ -48,16 +74,29 @@ type Listener struct {
 	Engine     EngineType
 	Transport  string       // transport layer default to tcp
 	Activate   func() error // function is used to activate the engine. it must be called before reading packets
-	Handles    map[string]*pcap.Handle
+	Handles    map[string]captureHandle
 	Interfaces []NetInterface
 	Reading    chan bool // this channel is closed when the listener has started reading packets
 
+	// StatsHandler, if set, is called periodically (every StatsInterval,
+	// default 5s) from a background goroutine started by Listen with the
+	// result of Stats(), so operators can wire capture health into
+	// Prometheus/statsd.
+	StatsHandler  func(map[string]CaptureStats)
+	StatsInterval time.Duration
+
 	host          string // pcap file name or interface (name, hardware addr, index or ip address)
 	port          uint16 // src or/and dst port
 	trackResponse bool
 
-	quit    chan bool
-	packets chan gopacket.Packet
+	quit     chan bool
+	packets  chan gopacket.Packet
+	counters map[string]*handleCounters
+
+	// fanoutGroup is the PACKET_FANOUT group this Listener's af_packet
+	// sockets join; allocated anew for each interface in activateAFPacket
+	// (linux only).
+	fanoutGroup uint16
 }
 
 // EngineType ...
@@ -67,6 +106,7 @@ type EngineType uint8
 const (
 	EnginePcap EngineType = iota
 	EnginePcapFile
+	EngineAFPacket
 )
 
 // Set is here so that EngineType can implement flag.Var
@@ -76,6 +116,8 @@ func (eng *EngineType) Set(v string) error {
 		*eng = EnginePcap
 	case "pcap_file":
 		*eng = EnginePcapFile
+	case "af_packet":
+		*eng = EngineAFPacket
 	default:
 		return fmt.Errorf("invalid engine %s", v)
 	}
@@ -88,6 +130,8 @@ func (eng *EngineType) String() (e string) {
 		e = "pcap_file"
 	case EnginePcap:
 		e = "libpcap"
+	case EngineAFPacket:
+		e = "af_packet"
 	default:
 		e = ""
 	}
@@ -111,9 +155,10 @@ func NewListener(host string, port uint16, transport string, engine EngineType,
 			}
 		}
 	}
-	l.Handles = make(map[string]*pcap.Handle)
+	l.Handles = make(map[string]captureHandle)
 	l.trackResponse = trackResponse
 	l.packets = make(chan gopacket.Packet, 1000)
+	l.counters = make(map[string]*handleCounters)
 	l.quit = make(chan bool, 1)
 	l.Reading = make(chan bool, 1)
 	l.Activate = l.activatePcap
@@ -123,6 +168,10 @@ func NewListener(host string, port uint16, transport string, engine EngineType,
 		l.Engine = EnginePcapFile
 		return
 	}
+	if engine == EngineAFPacket {
+		l.Activate = l.activateAFPacket
+		l.Engine = EngineAFPacket
+	}
 	err = l.setInterfaces()
 	if err != nil {
 		return nil, err
@@ -141,6 +190,11 @@ func (l *Listener) SetPcapOptions(opts PcapOptions) {
 // this function should be called after activating pcap handles
 func (l *Listener) Listen(ctx context.Context, handler Handler) (err error) {
 	l.read()
+	statsDone := make(chan struct{})
+	defer close(statsDone)
+	if l.StatsHandler != nil {
+		go l.sampleStats(ctx, statsDone)
+	}
 	done := ctx.Done()
 	var p gopacket.Packet
 	var ok bool
@@ -205,7 +259,7 @@ func PcapDumpHandler(file *os.File, link layers.LinkType, debugger func(int, ...
 	if link.String() == "" {
 		link = layers.LinkTypeEthernet
 	}
-	w := NewWriterNanos(file)
+	w := pcapgo.NewWriterNanos(file)
 	err = w.WriteFileHeader(64<<10, link)
 	if err != nil {
 		return nil, err
@@ -300,8 +354,11 @@ func (l *Listener) read() {
 		source.Lazy = true
 		source.NoCopy = true
 		ch := source.Packets()
-		go func(handle *pcap.Handle, key string) {
+		ifaceIndex := l.interfaceIndex(key)
+		l.counters[key] = &handleCounters{}
+		go func(handle captureHandle, key string, ifaceIndex int) {
 			defer l.closeHandle(key)
+			counters := l.counters[key]
 			for {
 				select {
 				case <-l.quit:
@@ -310,11 +367,35 @@ func (l *Listener) read() {
 					if !ok {
 						return
 					}
-					l.packets <- p
+					p.Metadata().CaptureInfo.InterfaceIndex = ifaceIndex
+					select {
+					case l.packets <- p:
+						atomic.AddUint64(&counters.delivered, 1)
+					default:
+						atomic.AddUint64(&counters.channelDropped, 1)
+					}
 				}
 			}
-		}(handle, key)
+		}(handle, key, ifaceIndex)
+	}
+}
+
+// interfaceIndex returns the position of the NetInterface backing the
+// handle key in l.Interfaces, so capture.Info.InterfaceIndex can be used
+// to look up the matching Interface Description Block when dumping to
+// pcapng. key may carry an af_packet fanout suffix ("eth0#2"), which is
+// stripped before lookup since every socket for an interface shares one IDB.
+func (l *Listener) interfaceIndex(key string) int {
+	name := key
+	if i := strings.IndexByte(key, '#'); i != -1 {
+		name = key[:i]
+	}
+	for i, ifi := range l.Interfaces {
+		if ifi.Name == name {
+			return i
+		}
 	}
+	return -1
 }
 
 func (l *Listener) closeHandle(key string) {
@@ -339,7 +420,7 @@ func (l *Listener) activatePcap() (err error) {
 			msg += ("\n" + e.Error())
 			continue
 		}
-		l.Handles[ifi.Name] = handle
+		l.Handles[ifi.Name] = pcapHandle{handle}
 	}
 	if len(l.Handles) == 0 {
 		return fmt.Errorf("pcap handles error:%s", msg)
@@ -370,7 +451,7 @@ func (l *Listener) activatePcapFile() (err error) {
 		handle.Close()
 		return fmt.Errorf("BPF filter error: %q, filter: %s", e, l.BPFFilter)
 	}
-	l.Handles["pcap_file"] = handle
+	l.Handles["pcap_file"] = pcapHandle{handle}
 	return
 }
 
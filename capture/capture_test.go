@@ -0,0 +1,31 @@
+package capture
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListenerInterfaceIndex(t *testing.T) {
+	l := &Listener{
+		Interfaces: []NetInterface{
+			{Interface: net.Interface{Name: "eth0"}},
+			{Interface: net.Interface{Name: "eth1"}},
+		},
+	}
+
+	cases := []struct {
+		key  string
+		want int
+	}{
+		{"eth0", 0},
+		{"eth1", 1},
+		{"eth1#3", 1}, // af_packet fanout suffix is stripped before lookup
+		{"eth2", -1},  // unknown interface
+	}
+
+	for _, c := range cases {
+		if got := l.interfaceIndex(c.key); got != c.want {
+			t.Errorf("interfaceIndex(%q) = %d, want %d", c.key, got, c.want)
+		}
+	}
+}
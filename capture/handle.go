@@ -0,0 +1,52 @@
+package capture
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// HandleStats is a normalized view of the counters exposed by the
+// underlying capture engine (libpcap or af_packet), independent of
+// the concrete type backing a captureHandle.
+type HandleStats struct {
+	PacketsReceived  uint64
+	PacketsDropped   uint64
+	PacketsIfDropped uint64
+}
+
+// captureHandle abstracts over the capture engines a Listener can drive
+// (libpcap, pcap file, af_packet) so the packet-source loop in read()
+// and the Handles map do not need to know which one is in use.
+type captureHandle interface {
+	LinkType() layers.LinkType
+	ReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error)
+	Stats() (HandleStats, error)
+	Close()
+}
+
+// packetWriter is implemented by capture handles that can inject packets
+// back onto the wire. The libpcap and af_packet handles both implement it;
+// Inject refuses pcap file listeners through the Engine check, not through
+// this interface.
+type packetWriter interface {
+	WritePacketData(data []byte) error
+}
+
+// pcapHandle adapts a *pcap.Handle to captureHandle, normalizing
+// pcap.Stats into HandleStats.
+type pcapHandle struct {
+	*pcap.Handle
+}
+
+func (h pcapHandle) Stats() (HandleStats, error) {
+	s, err := h.Handle.Stats()
+	if err != nil {
+		return HandleStats{}, err
+	}
+	return HandleStats{
+		PacketsReceived:  uint64(s.PacketsReceived),
+		PacketsDropped:   uint64(s.PacketsDropped),
+		PacketsIfDropped: uint64(s.PacketsIfDropped),
+	}, nil
+}
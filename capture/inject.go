@@ -0,0 +1,42 @@
+package capture
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+)
+
+// Inject writes a raw packet out on the handle for ifiName, e.g. for TCP RST
+// injection or synthetic ARP probes. The Listener must have been configured
+// with PcapOptions.Writable and must not be using EnginePcapFile.
+func (l *Listener) Inject(ifiName string, data []byte) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.Writable {
+		return fmt.Errorf("inject error: listener does not have PcapOptions.Writable set, interface: %q", ifiName)
+	}
+	if l.Engine == EnginePcapFile {
+		return fmt.Errorf("inject error: can not write to a pcap file engine")
+	}
+	handle, ok := l.Handles[ifiName]
+	if !ok {
+		return fmt.Errorf("inject error: no handle for interface %q", ifiName)
+	}
+	writer, ok := handle.(packetWriter)
+	if !ok {
+		return fmt.Errorf("inject error: handle for interface %q does not support injection", ifiName)
+	}
+	return writer.WritePacketData(data)
+}
+
+// InjectLayers serializes layers with checksums and length fields
+// recomputed, then injects the result on ifiName via Inject.
+func (l *Listener) InjectLayers(ifiName string, layers ...gopacket.SerializableLayer) error {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, layers...); err != nil {
+		return fmt.Errorf("inject error: serialize layers: %q", err)
+	}
+	return l.Inject(ifiName, buf.Bytes())
+}
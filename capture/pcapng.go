@@ -0,0 +1,97 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// PcapngOptions controls the metadata PcapngDumpHandler records in the
+// Section Header Block and each Interface Description Block.
+type PcapngOptions struct {
+	// SectionComment annotates the Section Header Block, e.g. goreplay
+	// version or invocation.
+	SectionComment string
+	// BPFFilter is recorded as if_filter on every Interface Description
+	// Block. Callers typically pass Listener.BPFFilter here.
+	BPFFilter string
+	// SnapLen is recorded on every Interface Description Block; 0 means
+	// "unlimited" to readers.
+	SnapLen uint32
+}
+
+// PcapngDumpHandler returns a handler that writes packets in pcapng format:
+// a Section Header Block, one Interface Description Block per entry in
+// ifaces (carrying if_name, if_description, if_tsresol and the active
+// if_filter; the MAC address and all IP addresses are folded into if_description since
+// gopacket's pcapgo writer has no dedicated option for them), and Enhanced
+// Packet Blocks tagged with the IDB of the interface that captured them.
+//
+// Packets must carry the originating interface in
+// packet.Metadata().CaptureInfo.InterfaceIndex, matching the position of
+// that interface in ifaces; Listener.read() sets this automatically.
+// debugger, as with PcapDumpHandler, is called on write/flush errors so a
+// failure (e.g. disk full mid-capture) isn't silently swallowed.
+func PcapngDumpHandler(file *os.File, ifaces []NetInterface, opts PcapngOptions, debugger func(int, ...interface{})) (handler func(packet gopacket.Packet), err error) {
+	if len(ifaces) == 0 {
+		return nil, fmt.Errorf("pcapng dump error: no interfaces given")
+	}
+
+	w, err := pcapgo.NewNgWriterInterface(file, ngInterface(ifaces[0], opts), pcapgo.NgWriterOptions{
+		SectionInfo: pcapgo.NgSectionInfo{
+			Comment:     opts.SectionComment,
+			Application: "goreplay",
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pcapng header error: %q", err)
+	}
+
+	for i := 1; i < len(ifaces); i++ {
+		if _, e := w.AddInterface(ngInterface(ifaces[i], opts)); e != nil {
+			return nil, fmt.Errorf("pcapng interface block error: %q, interface: %q", e, ifaces[i].Name)
+		}
+	}
+
+	return func(packet gopacket.Packet) {
+		ci := packet.Metadata().CaptureInfo
+		if ci.InterfaceIndex < 0 || ci.InterfaceIndex >= len(ifaces) {
+			ci.InterfaceIndex = 0
+		}
+		if e := w.WritePacket(ci, packet.Data()); e != nil {
+			if debugger != nil {
+				go debugger(3, e)
+			}
+			return
+		}
+		if e := w.Flush(); e != nil && debugger != nil {
+			go debugger(3, e)
+		}
+	}, nil
+}
+
+// ngInterface builds the Interface Description Block for ifi. if_tsresol is
+// left at the writer's default (nanosecond) resolution to match
+// Listener.read(), which delivers nanosecond-precision CaptureInfo from
+// both the libpcap and af_packet engines.
+func ngInterface(ifi NetInterface, opts PcapngOptions) pcapgo.NgInterface {
+	desc := ifi.HardwareAddr.String()
+	for _, ip := range ifi.IPs {
+		if desc != "" {
+			desc += ", "
+		}
+		desc += ip
+	}
+	return pcapgo.NgInterface{
+		Name:        ifi.Name,
+		Description: strings.TrimSpace(desc),
+		Filter:      opts.BPFFilter,
+		OS:          "",
+		LinkType:    layers.LinkTypeEthernet,
+		SnapLength:  opts.SnapLen,
+	}
+}
@@ -0,0 +1,235 @@
+package capture
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/goreplay/size"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// RotateOptions controls when RotatingPcapDumpHandler rolls to a new output
+// file. A zero value for a threshold means that trigger is disabled; at
+// least one threshold should be set or the handler never rotates.
+type RotateOptions struct {
+	MaxBytes    size.Size     // rotate once the current file reaches this size
+	MaxDuration time.Duration // rotate once the current file has been open this long
+	MaxPackets  int           // rotate once this many packets have been written
+
+	// FilenamePattern names each rotated file, interpreted with
+	// strftime-style placeholders: %Y%m%d-%H%M%S from the rotation time,
+	// %i for a zero-padded sequence number, and %if for the capturing
+	// interface name (IfaceName). Defaults to "%Y%m%d-%H%M%S-%i.pcap".
+	FilenamePattern string
+	// IfaceName is substituted for %if in FilenamePattern.
+	IfaceName string
+	// Gzip compresses each rotated-out file in the background, appending ".gz".
+	Gzip bool
+}
+
+const defaultFilenamePattern = "%Y%m%d-%H%M%S-%i.pcap"
+
+// Sizes of the pcap file header and per-packet record header, counted
+// toward MaxBytes so it tracks the size of the file on disk.
+const (
+	pcapFileHeaderLen   = 24
+	pcapRecordHeaderLen = 16
+)
+
+// RotatingPcapDumpHandler is like PcapDumpHandler but rolls the output file
+// to dir once any of opts' thresholds is hit, so long-running captures don't
+// exhaust disk. Call the returned closer when done to flush and finalize the
+// current file.
+func RotatingPcapDumpHandler(dir string, opts RotateOptions, link layers.LinkType, debugger func(int, ...interface{})) (handler Handler, closer func() error, err error) {
+	if opts.FilenamePattern == "" {
+		opts.FilenamePattern = defaultFilenamePattern
+	}
+	if link.String() == "" {
+		link = layers.LinkTypeEthernet
+	}
+	d := &rotatingDumper{
+		dir:      dir,
+		opts:     opts,
+		link:     link,
+		debugger: debugger,
+	}
+	if err = d.rotate(); err != nil {
+		return nil, nil, err
+	}
+	return d.handle, d.Close, nil
+}
+
+type rotatingDumper struct {
+	sync.Mutex
+
+	dir      string
+	opts     RotateOptions
+	link     layers.LinkType
+	debugger func(int, ...interface{})
+
+	file    *os.File
+	w       *pcapgo.Writer
+	seq     int
+	opened  time.Time
+	bytes   size.Size
+	packets int
+}
+
+func (d *rotatingDumper) handle(packet gopacket.Packet) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.shouldRotateLocked() {
+		if err := d.rotateLocked(); err != nil {
+			if d.debugger != nil {
+				go d.debugger(3, err)
+			}
+			return
+		}
+	}
+
+	ci := packet.Metadata().CaptureInfo
+	if err := d.w.WritePacket(ci, packet.Data()); err != nil {
+		if d.debugger != nil {
+			go d.debugger(3, err)
+		}
+		return
+	}
+	d.bytes += size.Size(pcapRecordHeaderLen + ci.CaptureLength)
+	d.packets++
+}
+
+func (d *rotatingDumper) shouldRotateLocked() bool {
+	if d.file == nil {
+		return true
+	}
+	if d.opts.MaxBytes > 0 && d.bytes >= d.opts.MaxBytes {
+		return true
+	}
+	if d.opts.MaxDuration > 0 && time.Since(d.opened) >= d.opts.MaxDuration {
+		return true
+	}
+	if d.opts.MaxPackets > 0 && d.packets >= d.opts.MaxPackets {
+		return true
+	}
+	return false
+}
+
+// rotate opens the first output file. Unlike rotateLocked it has nothing to
+// close or gzip yet.
+func (d *rotatingDumper) rotate() error {
+	d.Lock()
+	defer d.Unlock()
+	return d.rotateLocked()
+}
+
+func (d *rotatingDumper) rotateLocked() error {
+	prev := d.file
+	name := formatFilename(d.opts.FilenamePattern, time.Now(), d.seq, d.opts.IfaceName)
+	d.seq++
+
+	file, err := os.Create(filepath.Join(d.dir, name))
+	if err != nil {
+		return fmt.Errorf("rotate pcap dump error: %q, file: %q", err, name)
+	}
+	w := pcapgo.NewWriterNanos(file)
+	if err = w.WriteFileHeader(64<<10, d.link); err != nil {
+		file.Close()
+		return fmt.Errorf("rotate pcap dump header error: %q, file: %q", err, name)
+	}
+
+	d.file = file
+	d.w = w
+	d.opened = time.Now()
+	d.bytes = pcapFileHeaderLen
+	d.packets = 0
+
+	if prev != nil {
+		d.finalize(prev)
+	}
+	return nil
+}
+
+// finalize closes a rotated-out file and, if requested, gzips it in the
+// background so the capture loop never blocks on compression.
+func (d *rotatingDumper) finalize(file *os.File) {
+	if !d.opts.Gzip {
+		file.Close()
+		return
+	}
+	go func() {
+		defer file.Close()
+		if err := gzipAndRemove(file.Name()); err != nil && d.debugger != nil {
+			go d.debugger(3, err)
+		}
+	}()
+}
+
+// Close flushes and finalizes the currently open file.
+func (d *rotatingDumper) Close() error {
+	d.Lock()
+	defer d.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	file := d.file
+	d.file = nil
+	d.w = nil
+	if d.opts.Gzip {
+		file.Close()
+		return gzipAndRemove(file.Name())
+	}
+	return file.Close()
+}
+
+func gzipAndRemove(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(out)
+	if _, err = io.Copy(gw, in); err != nil {
+		gw.Close()
+		out.Close()
+		return err
+	}
+	if err = gw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// formatFilename expands the strftime-style placeholders supported by
+// RotateOptions.FilenamePattern: %Y%m%d-%H%M%S (rotation time), %i
+// (zero-padded sequence number) and %if (capturing interface name).
+func formatFilename(pattern string, t time.Time, seq int, iface string) string {
+	replacer := strings.NewReplacer(
+		"%Y", t.Format("2006"),
+		"%m", t.Format("01"),
+		"%d", t.Format("02"),
+		"%H", t.Format("15"),
+		"%M", t.Format("04"),
+		"%S", t.Format("05"),
+		"%if", iface,
+		"%i", fmt.Sprintf("%04d", seq),
+	)
+	return replacer.Replace(pattern)
+}
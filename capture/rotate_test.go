@@ -0,0 +1,138 @@
+package capture
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/size"
+)
+
+func TestFormatFilename(t *testing.T) {
+	ts := time.Date(2026, 7, 25, 13, 5, 9, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		pattern string
+		seq     int
+		iface   string
+		want    string
+	}{
+		{
+			name:    "default pattern",
+			pattern: defaultFilenamePattern,
+			seq:     3,
+			iface:   "eth0",
+			want:    "20260725-130509-0003.pcap",
+		},
+		{
+			name:    "interface placeholder does not collide with sequence placeholder",
+			pattern: "%if-%i.pcap",
+			seq:     1,
+			iface:   "eth1",
+			want:    "eth1-0001.pcap",
+		},
+		{
+			name:    "no placeholders",
+			pattern: "capture.pcap",
+			seq:     7,
+			iface:   "eth0",
+			want:    "capture.pcap",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := formatFilename(c.pattern, ts, c.seq, c.iface)
+			if got != c.want {
+				t.Errorf("formatFilename(%q, seq=%d, iface=%q) = %q, want %q", c.pattern, c.seq, c.iface, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRotatingDumperShouldRotate(t *testing.T) {
+	openFile := func() *os.File {
+		f, err := os.CreateTemp(t.TempDir(), "rotate")
+		if err != nil {
+			t.Fatalf("CreateTemp: %v", err)
+		}
+		return f
+	}
+
+	t.Run("no file yet always rotates", func(t *testing.T) {
+		d := &rotatingDumper{}
+		if !d.shouldRotateLocked() {
+			t.Error("expected shouldRotateLocked to be true before a file is open")
+		}
+	})
+
+	t.Run("under every threshold does not rotate", func(t *testing.T) {
+		f := openFile()
+		defer f.Close()
+		d := &rotatingDumper{
+			file:    f,
+			opts:    RotateOptions{MaxBytes: 1 << 20, MaxDuration: time.Hour, MaxPackets: 100},
+			opened:  time.Now(),
+			bytes:   10,
+			packets: 1,
+		}
+		if d.shouldRotateLocked() {
+			t.Error("expected shouldRotateLocked to be false under all thresholds")
+		}
+	})
+
+	t.Run("MaxBytes trigger", func(t *testing.T) {
+		f := openFile()
+		defer f.Close()
+		d := &rotatingDumper{
+			file:   f,
+			opts:   RotateOptions{MaxBytes: 100},
+			opened: time.Now(),
+			bytes:  100,
+		}
+		if !d.shouldRotateLocked() {
+			t.Error("expected shouldRotateLocked to be true once bytes reach MaxBytes")
+		}
+	})
+
+	t.Run("MaxDuration trigger", func(t *testing.T) {
+		f := openFile()
+		defer f.Close()
+		d := &rotatingDumper{
+			file:   f,
+			opts:   RotateOptions{MaxDuration: time.Millisecond},
+			opened: time.Now().Add(-time.Second),
+		}
+		if !d.shouldRotateLocked() {
+			t.Error("expected shouldRotateLocked to be true once MaxDuration has elapsed")
+		}
+	})
+
+	t.Run("MaxPackets trigger", func(t *testing.T) {
+		f := openFile()
+		defer f.Close()
+		d := &rotatingDumper{
+			file:    f,
+			opts:    RotateOptions{MaxPackets: 5},
+			opened:  time.Now(),
+			packets: 5,
+		}
+		if !d.shouldRotateLocked() {
+			t.Error("expected shouldRotateLocked to be true once packets reach MaxPackets")
+		}
+	})
+
+	t.Run("zero thresholds never rotate an open file", func(t *testing.T) {
+		f := openFile()
+		defer f.Close()
+		d := &rotatingDumper{
+			file:   f,
+			bytes:  size.Size(1 << 30),
+			opened: time.Now().Add(-time.Hour),
+		}
+		if d.shouldRotateLocked() {
+			t.Error("expected shouldRotateLocked to be false when no threshold is set")
+		}
+	})
+}
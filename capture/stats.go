@@ -0,0 +1,80 @@
+package capture
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// defaultStatsInterval is used when StatsInterval is left unset.
+const defaultStatsInterval = 5 * time.Second
+
+// handleCounters tracks goreplay-side packet accounting for one capture
+// handle, i.e. the part pcap/af_packet themselves don't know about.
+type handleCounters struct {
+	delivered      uint64 // packets handed off to l.packets
+	channelDropped uint64 // packets dropped because l.packets was full
+}
+
+// CaptureStats reports capture health for one interface: counters the
+// capture engine itself tracks (PacketsReceived/Dropped/IfDropped) plus
+// goreplay-side delivery/drop counters for the bounded send in read().
+type CaptureStats struct {
+	PacketsReceived  uint64
+	PacketsDropped   uint64
+	PacketsIfDropped uint64
+
+	PacketsDelivered      uint64
+	PacketsChannelDropped uint64
+
+	LastSample time.Time
+}
+
+// Stats returns capture statistics per interface, keyed the same as
+// l.Handles (af_packet fanout sockets get a "#N" suffix).
+func (l *Listener) Stats() map[string]CaptureStats {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	stats := make(map[string]CaptureStats, len(l.Handles))
+	for key, handle := range l.Handles {
+		hs, _ := handle.Stats()
+		s := CaptureStats{
+			PacketsReceived:  hs.PacketsReceived,
+			PacketsDropped:   hs.PacketsDropped,
+			PacketsIfDropped: hs.PacketsIfDropped,
+			LastSample:       now,
+		}
+		if c, ok := l.counters[key]; ok {
+			s.PacketsDelivered = atomic.LoadUint64(&c.delivered)
+			s.PacketsChannelDropped = atomic.LoadUint64(&c.channelDropped)
+		}
+		stats[key] = s
+	}
+	return stats
+}
+
+// sampleStats periodically pushes Stats() through StatsHandler until ctx is
+// done or done is closed. done is closed by Listen when it returns for any
+// reason, including EOF on l.packets with ctx still live (e.g. EnginePcapFile
+// finishing a file), so this goroutine never outlives the Listen call that
+// started it. Started from Listen when StatsHandler is set.
+func (l *Listener) sampleStats(ctx context.Context, done <-chan struct{}) {
+	interval := l.StatsInterval
+	if interval <= 0 {
+		interval = defaultStatsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			l.StatsHandler(l.Stats())
+		}
+	}
+}